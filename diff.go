@@ -0,0 +1,348 @@
+package interfaces
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// InverseIndexPatch is the set of repeated-field elements added to or removed
+// from an InverseIndexProto between two revisions, keyed by field number so
+// it survives schema evolution (new fields just appear as new entries).
+type InverseIndexPatch struct {
+	Added   map[protoreflect.FieldNumber][]protoreflect.Value
+	Removed map[protoreflect.FieldNumber][]protoreflect.Value
+}
+
+// DiffInverseIndexProto computes the patch that turns old into new by walking
+// both messages' repeated fields through the protoreflect descriptor rather
+// than hardcoding field access. This is what lets the incremental update path
+// pick up new posting-related fields (positions, checksums, ...) without any
+// changes here.
+func DiffInverseIndexProto(old, updated InverseIndexProto) (InverseIndexPatch, error) {
+	return diffMessages(old.ProtoReflect(), updated.ProtoReflect())
+}
+
+// diffMessages is the protoreflect.Message-only core of DiffInverseIndexProto,
+// split out so it can be unit tested against any proto message (not just the
+// concrete InverseIndexProto type this package wraps).
+func diffMessages(oldMsg, newMsg protoreflect.Message) (InverseIndexPatch, error) {
+	if oldMsg.Descriptor().FullName() != newMsg.Descriptor().FullName() {
+		return InverseIndexPatch{}, fmt.Errorf("diff inverse index proto: message type mismatch: %s vs %s",
+			oldMsg.Descriptor().FullName(), newMsg.Descriptor().FullName())
+	}
+
+	patch := InverseIndexPatch{
+		Added:   map[protoreflect.FieldNumber][]protoreflect.Value{},
+		Removed: map[protoreflect.FieldNumber][]protoreflect.Value{},
+	}
+
+	fields := newMsg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !fd.IsList() {
+			continue
+		}
+		added, removed := diffRepeatedField(oldMsg, newMsg, fd)
+		if len(added) > 0 {
+			patch.Added[fd.Number()] = added
+		}
+		if len(removed) > 0 {
+			patch.Removed[fd.Number()] = removed
+		}
+	}
+	return patch, nil
+}
+
+func diffRepeatedField(oldMsg, newMsg protoreflect.Message, fd protoreflect.FieldDescriptor) (added, removed []protoreflect.Value) {
+	oldSet := repeatedFieldSet(oldMsg, fd)
+	newSet := repeatedFieldSet(newMsg, fd)
+
+	newList := newMsg.Get(fd).List()
+	for i := 0; i < newList.Len(); i++ {
+		v := newList.Get(i)
+		if _, ok := oldSet[valueKey(v)]; !ok {
+			added = append(added, v)
+		}
+	}
+	oldList := oldMsg.Get(fd).List()
+	for i := 0; i < oldList.Len(); i++ {
+		v := oldList.Get(i)
+		if _, ok := newSet[valueKey(v)]; !ok {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+func repeatedFieldSet(msg protoreflect.Message, fd protoreflect.FieldDescriptor) map[string]struct{} {
+	list := msg.Get(fd).List()
+	set := make(map[string]struct{}, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		set[valueKey(list.Get(i))] = struct{}{}
+	}
+	return set
+}
+
+// valueKey renders a protoreflect.Value to a comparable string. Message-typed
+// list elements (e.g. a posting entry) are keyed by their wire bytes so
+// equality matches proto semantics rather than pointer identity.
+func valueKey(v protoreflect.Value) string {
+	if msg, ok := v.Interface().(protoreflect.Message); ok {
+		b, err := proto.Marshal(msg.Interface())
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// ApplyInverseIndexPatch applies patch on top of base, returning the
+// resulting proto. It is the inverse of DiffInverseIndexProto and is what the
+// WAL replay path uses to reconstruct state without knowing the concrete
+// posting schema.
+func ApplyInverseIndexPatch(base InverseIndexProto, patch InverseIndexPatch) InverseIndexProto {
+	applyPatchToMessage(base.ProtoReflect(), patch)
+	return base
+}
+
+// applyPatchToMessage is the protoreflect.Message-only core of
+// ApplyInverseIndexPatch, mirroring diffMessages so both halves of the
+// round trip can be tested independently of InverseIndexProto.
+func applyPatchToMessage(msg protoreflect.Message, patch InverseIndexPatch) {
+	for num, removed := range patch.Removed {
+		fd := msg.Descriptor().Fields().ByNumber(num)
+		if fd == nil {
+			continue
+		}
+		removeListValues(msg, fd, removed)
+	}
+	for num, added := range patch.Added {
+		fd := msg.Descriptor().Fields().ByNumber(num)
+		if fd == nil {
+			continue
+		}
+		list := msg.Mutable(fd).List()
+		for _, v := range added {
+			list.Append(v)
+		}
+	}
+}
+
+func removeListValues(msg protoreflect.Message, fd protoreflect.FieldDescriptor, remove []protoreflect.Value) {
+	removeSet := make(map[string]struct{}, len(remove))
+	for _, v := range remove {
+		removeSet[valueKey(v)] = struct{}{}
+	}
+	list := msg.Mutable(fd).List()
+	kept := make([]protoreflect.Value, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		v := list.Get(i)
+		if _, drop := removeSet[valueKey(v)]; !drop {
+			kept = append(kept, v)
+		}
+	}
+	list.Truncate(0)
+	for _, v := range kept {
+		list.Append(v)
+	}
+}
+
+// wirePatch is the gob-encodable form of InverseIndexPatch used by the WAL.
+// InverseIndexPatch itself cannot be gob-encoded: its values are
+// protoreflect.Value, which wraps an interface carrying an incomparability
+// marker gob refuses to walk. encodePatch/decodePatch flatten each value to
+// tagged bytes instead, restoring them against the field descriptors of the
+// message the patch is applied to.
+type wirePatch struct {
+	Added   map[int32][][]byte
+	Removed map[int32][][]byte
+}
+
+// encodePatch flattens patch into its wire form. It needs no message or
+// descriptor: every protoreflect.Value already carries enough information in
+// its own Go type (string, []byte, a concrete generated message, ...) to be
+// flattened without consulting a schema. Decoding does consult one; see
+// decodePatch.
+func encodePatch(patch InverseIndexPatch) (wirePatch, error) {
+	wp := wirePatch{
+		Added:   make(map[int32][][]byte, len(patch.Added)),
+		Removed: make(map[int32][][]byte, len(patch.Removed)),
+	}
+	for num, values := range patch.Added {
+		encoded, err := encodePatchValues(values)
+		if err != nil {
+			return wirePatch{}, fmt.Errorf("encode patch: field %d added: %w", num, err)
+		}
+		wp.Added[int32(num)] = encoded
+	}
+	for num, values := range patch.Removed {
+		encoded, err := encodePatchValues(values)
+		if err != nil {
+			return wirePatch{}, fmt.Errorf("encode patch: field %d removed: %w", num, err)
+		}
+		wp.Removed[int32(num)] = encoded
+	}
+	return wp, nil
+}
+
+func encodePatchValues(values []protoreflect.Value) ([][]byte, error) {
+	encoded := make([][]byte, len(values))
+	for i, v := range values {
+		b, err := encodePatchValue(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+	}
+	return encoded, nil
+}
+
+// Tags identifying how a single value was flattened by encodePatchValue.
+const (
+	patchValueMessage byte = iota
+	patchValueString
+	patchValueBytes
+	patchValueBool
+	patchValueInt64
+	patchValueUint64
+	patchValueFloat64
+	patchValueEnum
+)
+
+func encodePatchValue(v protoreflect.Value) ([]byte, error) {
+	switch x := v.Interface().(type) {
+	case protoreflect.Message:
+		b, err := proto.Marshal(x.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("encode patch value: marshal message: %w", err)
+		}
+		return append([]byte{patchValueMessage}, b...), nil
+	case string:
+		return append([]byte{patchValueString}, []byte(x)...), nil
+	case []byte:
+		return append([]byte{patchValueBytes}, x...), nil
+	case bool:
+		if x {
+			return []byte{patchValueBool, 1}, nil
+		}
+		return []byte{patchValueBool, 0}, nil
+	case int32:
+		return encodeFixedPatchValue(patchValueInt64, uint64(x)), nil
+	case int64:
+		return encodeFixedPatchValue(patchValueInt64, uint64(x)), nil
+	case uint32:
+		return encodeFixedPatchValue(patchValueUint64, uint64(x)), nil
+	case uint64:
+		return encodeFixedPatchValue(patchValueUint64, x), nil
+	case float32:
+		return encodeFixedPatchValue(patchValueFloat64, math.Float64bits(float64(x))), nil
+	case float64:
+		return encodeFixedPatchValue(patchValueFloat64, math.Float64bits(x)), nil
+	case protoreflect.EnumNumber:
+		return encodeFixedPatchValue(patchValueEnum, uint64(x)), nil
+	default:
+		return nil, fmt.Errorf("encode patch value: unsupported value type %T", x)
+	}
+}
+
+func encodeFixedPatchValue(tag byte, n uint64) []byte {
+	buf := make([]byte, 9)
+	buf[0] = tag
+	binary.BigEndian.PutUint64(buf[1:], n)
+	return buf
+}
+
+// decodePatch restores the patch produced by encodePatch so it can be
+// applied to msg. Message-typed values need msg's field descriptors to know
+// which concrete generated type to unmarshal into; strings, bytes, bools and
+// enums decode from their tag alone, and numbers use the field's kind to
+// pick between their 32- and 64-bit forms.
+func decodePatch(msg protoreflect.Message, wp wirePatch) (InverseIndexPatch, error) {
+	patch := InverseIndexPatch{
+		Added:   make(map[protoreflect.FieldNumber][]protoreflect.Value, len(wp.Added)),
+		Removed: make(map[protoreflect.FieldNumber][]protoreflect.Value, len(wp.Removed)),
+	}
+	fields := msg.Descriptor().Fields()
+	for num, encoded := range wp.Added {
+		fd := fields.ByNumber(protoreflect.FieldNumber(num))
+		if fd == nil {
+			continue
+		}
+		values, err := decodePatchValues(msg, fd, encoded)
+		if err != nil {
+			return InverseIndexPatch{}, fmt.Errorf("decode patch: field %d added: %w", num, err)
+		}
+		patch.Added[fd.Number()] = values
+	}
+	for num, encoded := range wp.Removed {
+		fd := fields.ByNumber(protoreflect.FieldNumber(num))
+		if fd == nil {
+			continue
+		}
+		values, err := decodePatchValues(msg, fd, encoded)
+		if err != nil {
+			return InverseIndexPatch{}, fmt.Errorf("decode patch: field %d removed: %w", num, err)
+		}
+		patch.Removed[fd.Number()] = values
+	}
+	return patch, nil
+}
+
+func decodePatchValues(msg protoreflect.Message, fd protoreflect.FieldDescriptor, encoded [][]byte) ([]protoreflect.Value, error) {
+	values := make([]protoreflect.Value, len(encoded))
+	for i, b := range encoded {
+		v, err := decodePatchValue(msg, fd, b)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func decodePatchValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, data []byte) (protoreflect.Value, error) {
+	if len(data) == 0 {
+		return protoreflect.Value{}, fmt.Errorf("decode patch value: empty payload")
+	}
+	tag, payload := data[0], data[1:]
+	switch tag {
+	case patchValueMessage:
+		elem := msg.NewField(fd)
+		if err := proto.Unmarshal(payload, elem.Message().Interface()); err != nil {
+			return protoreflect.Value{}, fmt.Errorf("decode patch value: unmarshal message: %w", err)
+		}
+		return elem, nil
+	case patchValueString:
+		return protoreflect.ValueOfString(string(payload)), nil
+	case patchValueBytes:
+		return protoreflect.ValueOfBytes(payload), nil
+	case patchValueBool:
+		return protoreflect.ValueOfBool(payload[0] != 0), nil
+	case patchValueInt64:
+		n := int64(binary.BigEndian.Uint64(payload))
+		if fd.Kind() == protoreflect.Int32Kind || fd.Kind() == protoreflect.Sint32Kind || fd.Kind() == protoreflect.Sfixed32Kind {
+			return protoreflect.ValueOfInt32(int32(n)), nil
+		}
+		return protoreflect.ValueOfInt64(n), nil
+	case patchValueUint64:
+		n := binary.BigEndian.Uint64(payload)
+		if fd.Kind() == protoreflect.Uint32Kind || fd.Kind() == protoreflect.Fixed32Kind {
+			return protoreflect.ValueOfUint32(uint32(n)), nil
+		}
+		return protoreflect.ValueOfUint64(n), nil
+	case patchValueFloat64:
+		f := math.Float64frombits(binary.BigEndian.Uint64(payload))
+		if fd.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	case patchValueEnum:
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(int32(binary.BigEndian.Uint64(payload)))), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("decode patch value: unknown tag %d", tag)
+	}
+}
@@ -0,0 +1,67 @@
+package interfaces
+
+import (
+	"sort"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fieldmaskpb.FieldMask is a real generated proto message (shipped by
+// google.golang.org/protobuf itself) with a single repeated scalar field,
+// which makes it a convenient stand-in for exercising diffMessages and
+// applyPatchToMessage without needing InverseIndexProto's own generated code.
+
+func TestDiffMessagesThenApplyRoundTrips(t *testing.T) {
+	old := &fieldmaskpb.FieldMask{Paths: []string{"a", "b", "c"}}
+	updated := &fieldmaskpb.FieldMask{Paths: []string{"b", "c", "d"}}
+
+	patch, err := diffMessages(old.ProtoReflect(), updated.ProtoReflect())
+	if err != nil {
+		t.Fatalf("diffMessages: %v", err)
+	}
+
+	got := &fieldmaskpb.FieldMask{Paths: append([]string(nil), old.Paths...)}
+	applyPatchToMessage(got.ProtoReflect(), patch)
+
+	assertSamePaths(t, got.Paths, updated.Paths)
+}
+
+func TestDiffMessagesNoChangesProducesEmptyPatch(t *testing.T) {
+	a := &fieldmaskpb.FieldMask{Paths: []string{"x", "y"}}
+	b := &fieldmaskpb.FieldMask{Paths: []string{"x", "y"}}
+
+	patch, err := diffMessages(a.ProtoReflect(), b.ProtoReflect())
+	if err != nil {
+		t.Fatalf("diffMessages: %v", err)
+	}
+	if len(patch.Added) != 0 || len(patch.Removed) != 0 {
+		t.Errorf("diffMessages on identical messages: got Added=%v Removed=%v, want both empty", patch.Added, patch.Removed)
+	}
+}
+
+func TestDiffMessagesRejectsMismatchedMessageTypes(t *testing.T) {
+	old := (&fieldmaskpb.FieldMask{Paths: []string{"a"}}).ProtoReflect()
+	updated := (&timestamppb.Timestamp{}).ProtoReflect()
+
+	if _, err := diffMessages(old, updated); err == nil {
+		t.Fatal("diffMessages: expected an error for mismatched message types, got nil")
+	}
+}
+
+func assertSamePaths(t *testing.T, got, want []string) {
+	t.Helper()
+	gotSorted := append([]string(nil), got...)
+	wantSorted := append([]string(nil), want...)
+	sort.Strings(gotSorted)
+	sort.Strings(wantSorted)
+	if len(gotSorted) != len(wantSorted) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range gotSorted {
+		if gotSorted[i] != wantSorted[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"ide/internal/entities"
+)
+
+// Update applies an incremental or full rebuild to the inverse index,
+// depending on whether a prior proto is available. Cold starts and recovery
+// from a corrupted index take the full-build path; everyday edits take the
+// incremental path so indexing cost scales with the size of the change, not
+// the size of the workspace. A genuine storage error (as opposed to there
+// being no index yet) is never silently treated as a cold start -- that
+// would make a persistently failing storage layer indistinguishable from
+// ordinary startup forever.
+func (i *inverseIndexer) Update(
+	ctx context.Context, values []IrIndexResult, changes entities.FileChanges,
+) (InverseIndexProto, error) {
+	prev, err := i.storage.Load(ctx)
+	switch {
+	case errors.Is(err, ErrNoIndexStored):
+		return i.fullRebuild(ctx, values, changes)
+	case err != nil:
+		return InverseIndexProto{}, fmt.Errorf("incremental update: load previous index: %w", err)
+	case !prev.Valid():
+		log.Printf("incremental update: stored inverse index failed validation, falling back to full rebuild")
+		return i.fullRebuild(ctx, values, changes)
+	}
+
+	delta := valuesForChangedFiles(values, changes)
+	patched, err := i.builder.PatchInverseIndexProto(ctx, prev, delta, changes)
+	if err != nil {
+		return InverseIndexProto{}, fmt.Errorf("incremental update: patch: %w", err)
+	}
+	return patched, i.storage.Store(ctx, patched)
+}
+
+func (i *inverseIndexer) fullRebuild(
+	ctx context.Context, values []IrIndexResult, changes entities.FileChanges,
+) (InverseIndexProto, error) {
+	full, err := i.builder.BuildInverseIndexProto(ctx, values, changes)
+	if err != nil {
+		return InverseIndexProto{}, fmt.Errorf("incremental update: full rebuild: %w", err)
+	}
+	return full, i.storage.Store(ctx, full)
+}
+
+// valuesForChangedFiles narrows values down to the results belonging to files
+// present in changes, so the patch path never touches unrelated postings.
+func valuesForChangedFiles(values []IrIndexResult, changes entities.FileChanges) []IrIndexResult {
+	touched := changes.TouchedFileIDs()
+	if len(touched) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(touched))
+	for _, id := range touched {
+		set[id] = struct{}{}
+	}
+	delta := make([]IrIndexResult, 0, len(touched))
+	for _, v := range values {
+		if _, ok := set[v.FileID()]; ok {
+			delta = append(delta, v)
+		}
+	}
+	return delta
+}
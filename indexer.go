@@ -3,7 +3,7 @@ package interfaces
 import (
 	"context"
 	"fmt"
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
 	"ide/internal/code_indexer/services/pipeline"
 	"ide/internal/interfaces"
 )
@@ -19,6 +19,12 @@ type InverseProtoBuilderService interface {
 	BuildInverseIndexProto(
 		ctx context.Context, values []IrIndexResult, changes entities.FileChanges,
 	) (InverseIndexProto, error)
+
+	// PatchInverseIndexProto applies an incremental update to prev, limited to
+	// the files touched by changes, instead of rebuilding the whole index.
+	PatchInverseIndexProto(
+		ctx context.Context, prev InverseIndexProto, delta []IrIndexResult, changes entities.FileChanges,
+	) (InverseIndexProto, error)
 }
 
 
@@ -0,0 +1,493 @@
+package interfaces
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"ide/internal/code_indexer/services/pipeline"
+	"ide/internal/interfaces"
+)
+
+// postingIndex is the slice of InverseIndexProto that query evaluation needs.
+// Evaluating against an interface rather than the concrete proto type keeps
+// the parser/evaluator testable with a fake.
+type postingIndex interface {
+	PositionalPostings(field, term string) ([]DocPosting, error)
+	TermsWithPrefix(field, prefix string) []string
+	Universe() []DocID
+}
+
+// DocPosting is one term's occurrence positions within a single DocID, used
+// both to score matches by frequency and to verify phrase adjacency.
+type DocPosting struct {
+	Doc       DocID
+	Positions []int
+}
+
+// queryNode is one node of a parsed search query tree.
+type queryNode interface {
+	eval(ctx context.Context, idx postingIndex) (scoredDocs, error)
+}
+
+// Query is a parsed, ready-to-evaluate search query.
+type Query struct {
+	root queryNode
+}
+
+type termNode struct {
+	field string
+	term  string
+}
+
+type phraseNode struct {
+	field string
+	terms []string
+}
+
+type prefixNode struct {
+	field  string
+	prefix string
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+type notNode struct {
+	inner queryNode
+}
+
+// Hit is a single ranked result of a Search call.
+type Hit struct {
+	FileID   string
+	SymbolID string
+	Score    float64
+}
+
+type searchService struct {
+	storage interfaces.InverseIndexStorage
+	pool    pipeline.Pool
+}
+
+func newSearchService(storage interfaces.InverseIndexStorage, pool pipeline.Pool) interfaces.InverseIndexSearchService {
+	return &searchService{
+		storage: storage,
+		pool:    pool,
+	}
+}
+
+// Search evaluates query against the stored InverseIndexProto and returns
+// hits ordered by descending score, where score is the number of matching
+// occurrences each hit contributed across the query (term frequency for a
+// single term, summed frequency for AND/OR, phrase-occurrence count for a
+// phrase). The evaluation itself runs on the same pipeline.Pool used for
+// index builds so queries and builds share the same concurrency budget.
+func (s *searchService) Search(ctx context.Context, query Query) ([]Hit, error) {
+	idx, err := s.storage.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("search: load inverse index: %w", err)
+	}
+
+	resultCh := s.pool.Submit(func() (interface{}, error) {
+		return query.root.eval(ctx, idx)
+	})
+	res, err := resultCh.Wait(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("search: evaluate query: %w", err)
+	}
+
+	docs := res.(scoredDocs)
+	hits := make([]Hit, 0, len(docs))
+	for _, d := range docs {
+		fileID, symbolID := d.doc.split()
+		hits = append(hits, Hit{FileID: fileID, SymbolID: symbolID, Score: d.score})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits, nil
+}
+
+// ParseQuery tokenizes and parses a raw query string of the form
+// `field:term AND (other OR NOT third) AND "a phrase" OR prefix*` into a
+// Query tree. Supported operators are AND, OR and NOT (case-sensitive,
+// uppercase only), parenthesized groups, field scoping via "field:term",
+// double-quoted phrases, and trailing "*" for prefix/wildcard matches.
+// Operands written side by side with no AND or OR between them are rejected.
+func ParseQuery(raw string) (Query, error) {
+	tokens := tokenizeQuery(raw)
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+	if p.pos != len(p.tokens) {
+		return Query{}, fmt.Errorf("parse query: unexpected trailing token %q", p.tokens[p.pos])
+	}
+	return Query{root: root}, nil
+}
+
+// tokenizeQuery splits raw into tokens, treating "(" and ")" as their own
+// tokens and preserving whitespace inside double-quoted phrases so a later
+// stage can recover them as a single phrase token.
+func tokenizeQuery(raw string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			cur.WriteRune(r)
+		case inQuotes:
+			cur.WriteRune(r)
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "AND" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek() == "NOT" {
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("parse query: unexpected end of input")
+	case "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("parse query: expected closing paren")
+		}
+		return node, nil
+	default:
+		return parseTermToken(tok), nil
+	}
+}
+
+func parseTermToken(tok string) queryNode {
+	field := ""
+	if idx := strings.IndexByte(tok, ':'); idx >= 0 {
+		field, tok = tok[:idx], tok[idx+1:]
+	}
+	if strings.HasPrefix(tok, `"`) && strings.HasSuffix(tok, `"`) && len(tok) >= 2 {
+		return &phraseNode{field: field, terms: strings.Fields(tok[1 : len(tok)-1])}
+	}
+	if strings.HasSuffix(tok, "*") {
+		return &prefixNode{field: field, prefix: strings.TrimSuffix(tok, "*")}
+	}
+	return &termNode{field: field, term: tok}
+}
+
+func (n *termNode) eval(ctx context.Context, idx postingIndex) (scoredDocs, error) {
+	postings, err := idx.PositionalPostings(n.field, n.term)
+	if err != nil {
+		return nil, err
+	}
+	return postingsToScoredDocs(postings), nil
+}
+
+// eval matches n.terms as a contiguous phrase: a doc only qualifies if some
+// occurrence of terms[0] is immediately followed by terms[1] at the next
+// position, then terms[2] at the position after that, and so on. The score
+// is the number of such occurrences, so a doc containing the phrase twice
+// ranks above one containing it once.
+func (n *phraseNode) eval(ctx context.Context, idx postingIndex) (scoredDocs, error) {
+	if len(n.terms) == 0 {
+		return nil, nil
+	}
+
+	postingsByTerm := make([][]DocPosting, len(n.terms))
+	for i, term := range n.terms {
+		postings, err := idx.PositionalPostings(n.field, term)
+		if err != nil {
+			return nil, err
+		}
+		postingsByTerm[i] = postings
+	}
+
+	candidates := postingsToScoredDocs(postingsByTerm[0])
+	for _, postings := range postingsByTerm[1:] {
+		candidates = gallopingIntersect(candidates, postingsToScoredDocs(postings))
+	}
+
+	positionsByTerm := make([]map[DocID][]int, len(postingsByTerm))
+	for i, postings := range postingsByTerm {
+		m := make(map[DocID][]int, len(postings))
+		for _, p := range postings {
+			m[p.Doc] = p.Positions
+		}
+		positionsByTerm[i] = m
+	}
+
+	result := make(scoredDocs, 0, len(candidates))
+	for _, candidate := range candidates {
+		if occurrences := phraseOccurrences(candidate.doc, positionsByTerm); occurrences > 0 {
+			result = append(result, scoredDoc{doc: candidate.doc, score: float64(occurrences)})
+		}
+	}
+	return result, nil
+}
+
+// phraseOccurrences counts how many starting positions of the phrase's first
+// term are followed by every other term at the expected consecutive offset.
+func phraseOccurrences(doc DocID, positionsByTerm []map[DocID][]int) int {
+	starts := positionsByTerm[0][doc]
+	occurrences := 0
+	for _, start := range starts {
+		matched := true
+		for termIdx := 1; termIdx < len(positionsByTerm); termIdx++ {
+			if !containsPosition(positionsByTerm[termIdx][doc], start+termIdx) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			occurrences++
+		}
+	}
+	return occurrences
+}
+
+func containsPosition(positions []int, target int) bool {
+	i := sort.SearchInts(positions, target)
+	return i < len(positions) && positions[i] == target
+}
+
+func (n *prefixNode) eval(ctx context.Context, idx postingIndex) (scoredDocs, error) {
+	terms := idx.TermsWithPrefix(n.field, n.prefix)
+	var result scoredDocs
+	for _, term := range terms {
+		postings, err := idx.PositionalPostings(n.field, term)
+		if err != nil {
+			return nil, err
+		}
+		result = sortedMerge(result, postingsToScoredDocs(postings))
+	}
+	return result, nil
+}
+
+func (n *andNode) eval(ctx context.Context, idx postingIndex) (scoredDocs, error) {
+	left, err := n.left.eval(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+	return gallopingIntersect(left, right), nil
+}
+
+func (n *orNode) eval(ctx context.Context, idx postingIndex) (scoredDocs, error) {
+	left, err := n.left.eval(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+	return sortedMerge(left, right), nil
+}
+
+func (n *notNode) eval(ctx context.Context, idx postingIndex) (scoredDocs, error) {
+	inner, err := n.inner.eval(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+	return complement(universeScoredDocs(idx.Universe()), inner), nil
+}
+
+// scoredDoc is one DocID paired with how strongly it matched so far.
+type scoredDoc struct {
+	doc   DocID
+	score float64
+}
+
+// scoredDocs is sorted by doc ascending, same invariant the plain []DocID
+// postings lists carry, so gallopingIntersect/sortedMerge can still rely on
+// a single linear/galloping pass.
+type scoredDocs []scoredDoc
+
+func postingsToScoredDocs(postings []DocPosting) scoredDocs {
+	docs := make(scoredDocs, len(postings))
+	for i, p := range postings {
+		docs[i] = scoredDoc{doc: p.Doc, score: float64(len(p.Positions))}
+	}
+	return docs
+}
+
+// universeScoredDocs gives every doc in the index a neutral baseline score,
+// since a NOT match says nothing about how strongly a doc matches.
+func universeScoredDocs(ids []DocID) scoredDocs {
+	docs := make(scoredDocs, len(ids))
+	for i, id := range ids {
+		docs[i] = scoredDoc{doc: id, score: 1}
+	}
+	return docs
+}
+
+// gallopingIntersect intersects two sorted, deduplicated scoredDocs using a
+// galloping (exponential) search on the shorter list against the longer one.
+// Matching docs' scores add, so a doc matching both sides of an AND ranks
+// above one that barely cleared either side alone.
+func gallopingIntersect(a, b scoredDocs) scoredDocs {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	result := make(scoredDocs, 0, len(a))
+	bPos := 0
+	for _, v := range a {
+		step := 1
+		for bPos < len(b) && b[bPos].doc < v.doc {
+			next := bPos + step
+			if next >= len(b) || b[next].doc >= v.doc {
+				bPos = sort.Search(len(b)-bPos, func(i int) bool { return b[bPos+i].doc >= v.doc }) + bPos
+				break
+			}
+			bPos = next
+			step *= 2
+		}
+		if bPos < len(b) && b[bPos].doc == v.doc {
+			result = append(result, scoredDoc{doc: v.doc, score: v.score + b[bPos].score})
+			bPos++
+		}
+	}
+	return result
+}
+
+// sortedMerge unions two sorted, deduplicated scoredDocs, summing the score
+// of docs present on both sides.
+func sortedMerge(a, b scoredDocs) scoredDocs {
+	result := make(scoredDocs, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].doc < b[j].doc:
+			result = append(result, a[i])
+			i++
+		case a[i].doc > b[j].doc:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, scoredDoc{doc: a[i].doc, score: a[i].score + b[j].score})
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	result = append(result, b[j:]...)
+	return result
+}
+
+// complement returns universe minus exclude, both sorted and deduplicated,
+// keeping universe's score for whatever survives.
+func complement(universe, exclude scoredDocs) scoredDocs {
+	excluded := make(map[DocID]struct{}, len(exclude))
+	for _, d := range exclude {
+		excluded[d.doc] = struct{}{}
+	}
+	result := make(scoredDocs, 0, len(universe))
+	for _, d := range universe {
+		if _, ok := excluded[d.doc]; !ok {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// DocID identifies a single file/symbol pair within an InverseIndexProto's
+// posting lists, encoded as "<fileID>#<symbolID>" so it sorts by file first.
+type DocID string
+
+func (d DocID) split() (fileID, symbolID string) {
+	parts := strings.SplitN(string(d), "#", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
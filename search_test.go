@@ -0,0 +1,238 @@
+package interfaces
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fakeIndex is a minimal in-memory postingIndex used to exercise the parser
+// and evaluator without a real InverseIndexProto.
+type fakeIndex struct {
+	postings map[string][]DocPosting // "field:term" -> postings
+	terms    []string                // every indexed term, for prefix expansion
+	universe []DocID
+}
+
+func (f *fakeIndex) PositionalPostings(field, term string) ([]DocPosting, error) {
+	return f.postings[field+":"+term], nil
+}
+
+func (f *fakeIndex) TermsWithPrefix(field, prefix string) []string {
+	var matches []string
+	for _, t := range f.terms {
+		if len(t) >= len(prefix) && t[:len(prefix)] == prefix {
+			matches = append(matches, t)
+		}
+	}
+	return matches
+}
+
+func (f *fakeIndex) Universe() []DocID {
+	return f.universe
+}
+
+func newFakeIndex() *fakeIndex {
+	return &fakeIndex{postings: map[string][]DocPosting{}}
+}
+
+func (f *fakeIndex) index(field, term string, doc DocID, positions ...int) {
+	key := field + ":" + term
+	f.postings[key] = append(f.postings[key], DocPosting{Doc: doc, Positions: positions})
+	f.terms = append(f.terms, term)
+	for _, existing := range f.universe {
+		if existing == doc {
+			return
+		}
+	}
+	f.universe = append(f.universe, doc)
+}
+
+func evalQuery(t *testing.T, idx postingIndex, raw string) []DocID {
+	t.Helper()
+	q, err := ParseQuery(raw)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q): %v", raw, err)
+	}
+	docs, err := q.root.eval(context.Background(), idx)
+	if err != nil {
+		t.Fatalf("eval(%q): %v", raw, err)
+	}
+	ids := make([]DocID, len(docs))
+	for i, d := range docs {
+		ids[i] = d.doc
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestParseQueryTermMatchesPostings(t *testing.T) {
+	idx := newFakeIndex()
+	idx.index("", "foo", "a#1", 0)
+	idx.index("", "bar", "b#1", 0)
+
+	got := evalQuery(t, idx, "foo")
+	want := []DocID{"a#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("foo: got %v, want %v", got, want)
+	}
+}
+
+func TestParseQueryFieldScopedTerm(t *testing.T) {
+	idx := newFakeIndex()
+	idx.index("name", "foo", "a#1", 0)
+	idx.index("body", "foo", "b#1", 0)
+
+	got := evalQuery(t, idx, "name:foo")
+	want := []DocID{"a#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("name:foo: got %v, want %v", got, want)
+	}
+}
+
+func TestParseQueryAndIntersectsOrUnions(t *testing.T) {
+	idx := newFakeIndex()
+	idx.index("", "foo", "a#1", 0)
+	idx.index("", "foo", "b#1", 0)
+	idx.index("", "bar", "b#1", 0)
+	idx.index("", "bar", "c#1", 0)
+
+	if got, want := evalQuery(t, idx, "foo AND bar"), []DocID{"b#1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("foo AND bar: got %v, want %v", got, want)
+	}
+	if got, want := evalQuery(t, idx, "foo OR bar"), []DocID{"a#1", "b#1", "c#1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("foo OR bar: got %v, want %v", got, want)
+	}
+}
+
+func TestParseQueryNotComplementsUniverse(t *testing.T) {
+	idx := newFakeIndex()
+	idx.index("", "foo", "a#1", 0)
+	idx.index("", "foo", "b#1", 0)
+	idx.index("", "bar", "c#1", 0) // registers c#1 in the universe without matching foo
+
+	got := evalQuery(t, idx, "NOT foo")
+	want := []DocID{"c#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NOT foo: got %v, want %v", got, want)
+	}
+}
+
+func TestParseQueryPrefixExpandsAndUnionsMatchingTerms(t *testing.T) {
+	idx := newFakeIndex()
+	idx.index("", "handle", "a#1", 0)
+	idx.index("", "handler", "b#1", 0)
+	idx.index("", "other", "c#1", 0)
+
+	got := evalQuery(t, idx, "handl*")
+	want := []DocID{"a#1", "b#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("handl*: got %v, want %v", got, want)
+	}
+}
+
+func TestParseQueryGroupedParens(t *testing.T) {
+	idx := newFakeIndex()
+	idx.index("", "foo", "a#1", 0)
+	idx.index("", "bar", "a#1", 0)
+	idx.index("", "baz", "b#1", 0)
+
+	got := evalQuery(t, idx, "(foo AND bar) OR baz")
+	want := []DocID{"a#1", "b#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("(foo AND bar) OR baz: got %v, want %v", got, want)
+	}
+}
+
+func TestParseQueryPhraseRequiresConsecutivePositions(t *testing.T) {
+	idx := newFakeIndex()
+	// "quick brown" appears consecutively in a#1 ...
+	idx.index("", "quick", "a#1", 0)
+	idx.index("", "brown", "a#1", 1)
+	// ... but in b#1 the words are present, just not adjacent.
+	idx.index("", "quick", "b#1", 0)
+	idx.index("", "brown", "b#1", 5)
+
+	got := evalQuery(t, idx, `"quick brown"`)
+	want := []DocID{"a#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf(`"quick brown": got %v, want %v`, got, want)
+	}
+}
+
+func TestParseQueryPhraseScoresByOccurrenceCount(t *testing.T) {
+	idx := newFakeIndex()
+	// The phrase occurs twice in a#1, once in b#1.
+	idx.index("", "quick", "a#1", 0, 10)
+	idx.index("", "brown", "a#1", 1, 11)
+	idx.index("", "quick", "b#1", 0)
+	idx.index("", "brown", "b#1", 1)
+
+	q, err := ParseQuery(`"quick brown"`)
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	docs, err := q.root.eval(context.Background(), idx)
+	if err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+
+	scores := map[DocID]float64{}
+	for _, d := range docs {
+		scores[d.doc] = d.score
+	}
+	if scores["a#1"] != 2 {
+		t.Errorf("a#1 score = %v, want 2", scores["a#1"])
+	}
+	if scores["b#1"] != 1 {
+		t.Errorf("b#1 score = %v, want 1", scores["b#1"])
+	}
+}
+
+func TestParseQueryRejectsUnclosedParen(t *testing.T) {
+	if _, err := ParseQuery("(foo AND bar"); err == nil {
+		t.Fatal("expected an error for an unclosed paren, got nil")
+	}
+}
+
+func TestTokenizeQueryKeepsQuotedPhraseAsOneToken(t *testing.T) {
+	got := tokenizeQuery(`foo:"a b c" AND bar`)
+	want := []string{`foo:"a b c"`, "AND", "bar"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenizeQuery: got %v, want %v", got, want)
+	}
+}
+
+func TestGallopingIntersectSumsScores(t *testing.T) {
+	a := scoredDocs{{doc: "a", score: 1}, {doc: "b", score: 2}}
+	b := scoredDocs{{doc: "b", score: 3}, {doc: "c", score: 4}}
+
+	got := gallopingIntersect(a, b)
+	want := scoredDocs{{doc: "b", score: 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("gallopingIntersect: got %v, want %v", got, want)
+	}
+}
+
+func TestSortedMergeSumsOverlappingScores(t *testing.T) {
+	a := scoredDocs{{doc: "a", score: 1}, {doc: "b", score: 2}}
+	b := scoredDocs{{doc: "b", score: 3}, {doc: "c", score: 4}}
+
+	got := sortedMerge(a, b)
+	want := scoredDocs{{doc: "a", score: 1}, {doc: "b", score: 5}, {doc: "c", score: 4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedMerge: got %v, want %v", got, want)
+	}
+}
+
+func TestComplementKeepsOnlyUnexcludedDocs(t *testing.T) {
+	universe := scoredDocs{{doc: "a", score: 1}, {doc: "b", score: 1}, {doc: "c", score: 1}}
+	exclude := scoredDocs{{doc: "b", score: 1}}
+
+	got := complement(universe, exclude)
+	want := scoredDocs{{doc: "a", score: 1}, {doc: "c", score: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("complement: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,431 @@
+package interfaces
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentedStorage is a crash-safe, segmented on-disk InverseIndexStorage.
+// The live index is the merge of the segment set recorded in the manifest
+// plus a write-ahead log of patches applied since the newest segment was
+// written. Segments are merged by Compact once their count exceeds
+// compactThreshold, and the WAL is flushed to a new segment by Snapshot once
+// it reaches walThreshold entries.
+type segmentedStorage struct {
+	dir              string
+	compactThreshold int
+	walThreshold     int
+
+	mu         sync.Mutex
+	segments   []segment
+	nextSeq    int64
+	wal        *wal
+	walEntries int
+	live       InverseIndexProto
+	hasData    bool
+}
+
+// ErrNoIndexStored is returned by Load when the storage directory has never
+// had an index written to it, distinguishing an ordinary cold start from a
+// genuine storage failure so callers don't collapse the two into the same
+// "just rebuild" branch.
+var ErrNoIndexStored = errors.New("segmented storage: no inverse index stored yet")
+
+// segment is one immutable fragment of the inverse index, covering the files
+// indexed at the time it was written. Only segments listed in the manifest
+// are considered live; anything else on disk is a crash leftover.
+type segment struct {
+	path  string
+	files []string
+}
+
+func newSegmentedStorage(dir string, compactThreshold, walThreshold int) (*segmentedStorage, error) {
+	s := &segmentedStorage{dir: dir, compactThreshold: compactThreshold, walThreshold: walThreshold}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("segmented storage: create dir: %w", err)
+	}
+
+	segments, err := readManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("segmented storage: read manifest: %w", err)
+	}
+	s.segments = segments
+	// Orphaned segment files on disk count too, so their sequence numbers
+	// are never reissued.
+	onDisk, err := filepath.Glob(filepath.Join(dir, "segment-*.pb"))
+	if err != nil {
+		return nil, fmt.Errorf("segmented storage: list segments: %w", err)
+	}
+	known := append([]segment(nil), segments...)
+	for _, path := range onDisk {
+		known = append(known, segment{path: path})
+	}
+	s.nextSeq = nextSegmentSeq(known)
+
+	w, err := openWAL(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		return nil, fmt.Errorf("segmented storage: open wal: %w", err)
+	}
+	s.wal = w
+
+	idx, err := mergeSegments(s.segments)
+	if err != nil {
+		return nil, fmt.Errorf("segmented storage: merge segments: %w", err)
+	}
+	entries, err := s.wal.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("segmented storage: read wal: %w", err)
+	}
+	for _, e := range entries {
+		patch, err := decodePatch(idx.ProtoReflect(), e.Patch)
+		if err != nil {
+			return nil, fmt.Errorf("segmented storage: decode wal entry: %w", err)
+		}
+		idx = ApplyInverseIndexPatch(idx, patch)
+	}
+	s.live = idx
+	s.walEntries = len(entries)
+	s.hasData = len(s.segments) > 0 || len(entries) > 0
+	return s, nil
+}
+
+// Load returns the live index reconstructed at startup (or since the last
+// Store), kept in memory so reads never re-walk segments or the WAL. It
+// returns ErrNoIndexStored rather than a zero-value InverseIndexProto when
+// nothing has ever been stored, so callers can tell a fresh directory apart
+// from an index that failed to load.
+func (s *segmentedStorage) Load(ctx context.Context) (InverseIndexProto, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.hasData {
+		return InverseIndexProto{}, ErrNoIndexStored
+	}
+	return s.live, nil
+}
+
+// Store diffs idx against the in-memory live index (via protoreflect, so it
+// needs no field-by-field knowledge of the schema) and appends just the
+// resulting patch to the WAL, fsyncing before returning so a crash
+// immediately after Store cannot lose or half-apply the write. Unlike the
+// first cut of this storage, it never reloads segments or replays the WAL
+// from disk to do this diff -- that reload is exactly what made every Store
+// cost scale with the whole workspace instead of the size of the change.
+func (s *segmentedStorage) Store(ctx context.Context, idx InverseIndexProto) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	patch, err := DiffInverseIndexProto(s.live, idx)
+	if err != nil {
+		return fmt.Errorf("segmented storage: diff: %w", err)
+	}
+	wp, err := encodePatch(patch)
+	if err != nil {
+		return fmt.Errorf("segmented storage: encode patch: %w", err)
+	}
+	if err := s.wal.Append(walEntry{Patch: wp}); err != nil {
+		return fmt.Errorf("segmented storage: append wal: %w", err)
+	}
+	s.live = idx
+	s.walEntries++
+	s.hasData = true
+
+	if s.walEntries >= s.walThreshold {
+		if err := s.snapshotLocked(ctx); err != nil {
+			return fmt.Errorf("segmented storage: auto snapshot: %w", err)
+		}
+	}
+	if len(s.segments) > s.compactThreshold {
+		if err := s.compactLocked(ctx); err != nil {
+			return fmt.Errorf("segmented storage: auto compact: %w", err)
+		}
+	}
+	return nil
+}
+
+// Snapshot flushes the current live index out as a new immutable segment and
+// truncates the WAL, bounding replay time on the next startup. Store calls
+// this automatically once walThreshold is reached; it is also exposed so
+// callers can force a flush (e.g. before a graceful shutdown).
+func (s *segmentedStorage) Snapshot(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked(ctx)
+}
+
+func (s *segmentedStorage) snapshotLocked(ctx context.Context) error {
+	seg, err := s.writeSegmentLocked(s.live)
+	if err != nil {
+		return fmt.Errorf("snapshot: write segment: %w", err)
+	}
+
+	newSegments := make([]segment, 0, len(s.segments)+1)
+	newSegments = append(newSegments, s.segments...)
+	newSegments = append(newSegments, seg)
+	if err := writeManifest(s.dir, newSegments); err != nil {
+		return fmt.Errorf("snapshot: commit manifest: %w", err)
+	}
+	s.segments = newSegments
+
+	if err := s.wal.Truncate(); err != nil {
+		return fmt.Errorf("snapshot: truncate wal: %w", err)
+	}
+	s.walEntries = 0
+	return nil
+}
+
+// Compact merges the current segment set down to a single segment, keeping
+// the merge work at startup bounded; with fewer than two segments it does
+// nothing. Store calls this automatically once the segment count exceeds
+// compactThreshold; it is also exposed so callers can force a compaction
+// (e.g. from a maintenance endpoint).
+func (s *segmentedStorage) Compact(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compactLocked(ctx)
+}
+
+func (s *segmentedStorage) compactLocked(ctx context.Context) error {
+	if len(s.segments) < 2 {
+		return nil
+	}
+	merged, err := mergeSegments(s.segments)
+	if err != nil {
+		return fmt.Errorf("compact: merge: %w", err)
+	}
+	newSeg, err := s.writeSegmentLocked(merged)
+	if err != nil {
+		return fmt.Errorf("compact: write merged segment: %w", err)
+	}
+
+	// The manifest swap is the single atomic commit point: once it lands,
+	// the old segments are no longer reachable from any future Load, so a
+	// crash before this line leaves the stale segments as the live set
+	// (newSeg is simply an orphan to clean up later), and a crash after this
+	// line leaves newSeg as the live set with the old segments as harmless
+	// orphans. Either way mergeSegments never double-counts a segment that
+	// the merged segment already subsumes.
+	stale := s.segments
+	if err := writeManifest(s.dir, []segment{newSeg}); err != nil {
+		return fmt.Errorf("compact: commit manifest: %w", err)
+	}
+	s.segments = []segment{newSeg}
+
+	for _, old := range stale {
+		_ = os.Remove(old.path)
+	}
+	return nil
+}
+
+// writeSegmentLocked durably writes idx as a brand new segment file: the
+// proto is written to a temp file in the same directory, fsync'd, and
+// renamed into place, with the containing directory fsync'd afterwards so
+// the rename itself survives a crash. The file is never visible under its
+// final name until it is complete.
+func (s *segmentedStorage) writeSegmentLocked(idx InverseIndexProto) (segment, error) {
+	seq := s.nextSeq
+	s.nextSeq++
+
+	name := fmt.Sprintf("segment-%020d.pb", seq)
+	finalPath := filepath.Join(s.dir, name)
+	tmpPath := finalPath + ".tmp"
+
+	if err := idx.WriteFile(tmpPath); err != nil {
+		return segment{}, fmt.Errorf("write temp segment: %w", err)
+	}
+	if err := fsyncPath(tmpPath); err != nil {
+		return segment{}, fmt.Errorf("fsync temp segment: %w", err)
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return segment{}, fmt.Errorf("rename segment into place: %w", err)
+	}
+	if err := fsyncPath(s.dir); err != nil {
+		return segment{}, fmt.Errorf("fsync segment dir: %w", err)
+	}
+	return segment{path: finalPath, files: idx.FileIDs()}, nil
+}
+
+// manifestFileName names the file that atomically records the currently
+// live segment set, one basename per line.
+const manifestFileName = "MANIFEST"
+
+// readManifest loads the live segment set. A missing manifest means a fresh
+// directory, not an error -- it is what a first run looks like.
+func readManifest(dir string) ([]segment, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		return nil, nil
+	}
+	names := strings.Split(trimmed, "\n")
+	segments := make([]segment, 0, len(names))
+	for _, name := range names {
+		segments = append(segments, segment{path: filepath.Join(dir, name)})
+	}
+	return segments, nil
+}
+
+// writeManifest atomically replaces the manifest with segments, via the same
+// temp-file-then-rename discipline as writeSegmentLocked. This is the single
+// point where the "live" segment set changes, so Snapshot/Compact can only
+// ever leave either the old set or the new set live, never a mix.
+func writeManifest(dir string, segments []segment) error {
+	names := make([]string, len(segments))
+	for i, seg := range segments {
+		names[i] = filepath.Base(seg.path)
+	}
+	content := []byte(strings.Join(names, "\n"))
+
+	path := filepath.Join(dir, manifestFileName)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0o644); err != nil {
+		return fmt.Errorf("write temp manifest: %w", err)
+	}
+	if err := fsyncPath(tmpPath); err != nil {
+		return fmt.Errorf("fsync temp manifest: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("rename manifest into place: %w", err)
+	}
+	return fsyncPath(dir)
+}
+
+// fsyncPath opens path (file or directory) and fsyncs it. Fsyncing the
+// directory after a rename is what makes the rename itself crash-safe --
+// without it, a crash can leave the rename only durable in the page cache.
+func fsyncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// nextSegmentSeq picks the next unused sequence number so a restart never
+// reissues a sequence number already used by a live (or orphaned) segment.
+func nextSegmentSeq(segments []segment) int64 {
+	var max int64 = -1
+	for _, seg := range segments {
+		if seq, ok := parseSegmentSeq(seg.path); ok && seq > max {
+			max = seq
+		}
+	}
+	return max + 1
+}
+
+func parseSegmentSeq(path string) (int64, bool) {
+	name := filepath.Base(path)
+	name = strings.TrimPrefix(name, "segment-")
+	name = strings.TrimSuffix(name, ".pb")
+	seq, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+func mergeSegments(segments []segment) (InverseIndexProto, error) {
+	var merged InverseIndexProto
+	for _, seg := range segments {
+		frag, err := ReadInverseIndexProtoFile(seg.path)
+		if err != nil {
+			return InverseIndexProto{}, fmt.Errorf("merge segments: read %s: %w", seg.path, err)
+		}
+		merged = merged.Merge(frag)
+	}
+	return merged, nil
+}
+
+// wal is an append-only, fsync'd log of the InverseIndexPatches applied
+// since the last segment.
+type wal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// walEntry is the gob-encoded unit written to the WAL. Its Patch field must
+// stay exported and in the gob-safe wirePatch form: InverseIndexPatch's own
+// protoreflect.Value fields cannot be gob-encoded (gob has no way to walk the
+// interface they wrap), which previously made every Append fail silently
+// into a returned error on every Store once there was anything to persist.
+type walEntry struct {
+	Patch wirePatch
+}
+
+func openWAL(path string) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{file: f}, nil
+}
+
+func (w *wal) Append(e walEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := encodeWALEntry(w.file, e); err != nil {
+		return fmt.Errorf("wal append: encode: %w", err)
+	}
+	return w.file.Sync()
+}
+
+func (w *wal) ReadAll() ([]walEntry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return decodeWALEntries(w.file)
+}
+
+func encodeWALEntry(w io.Writer, e walEntry) error {
+	return gob.NewEncoder(w).Encode(e)
+}
+
+func decodeWALEntries(r io.ReadSeeker) ([]walEntry, error) {
+	if _, err := r.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	// Each entry was written by its own gob.Encoder and so carries its own
+	// type definitions; a single Decoder rejects the repeats, so every entry
+	// gets a fresh Decoder over one shared buffered reader.
+	br := bufio.NewReader(r)
+	var entries []walEntry
+	for {
+		var e walEntry
+		if err := gob.NewDecoder(br).Decode(&e); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (w *wal) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, 0); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
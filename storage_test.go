@@ -0,0 +1,166 @@
+package interfaces
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestWriteManifestThenReadManifestRoundTrips(t *testing.T) {
+	dir := t.TempDir()
+	segments := []segment{
+		{path: filepath.Join(dir, "segment-00000000000000000000.pb")},
+		{path: filepath.Join(dir, "segment-00000000000000000001.pb")},
+	}
+
+	if err := writeManifest(dir, segments); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+
+	got, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	if len(got) != len(segments) {
+		t.Fatalf("readManifest: got %d segments, want %d", len(got), len(segments))
+	}
+	for i, seg := range got {
+		if seg.path != segments[i].path {
+			t.Errorf("segment %d: got path %q, want %q", i, seg.path, segments[i].path)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, manifestFileName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("writeManifest left a temp file behind: err=%v", err)
+	}
+}
+
+func TestReadManifestMissingIsEmptyNotError(t *testing.T) {
+	dir := t.TempDir()
+
+	segments, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest on fresh dir: %v", err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("readManifest on fresh dir: got %d segments, want 0", len(segments))
+	}
+}
+
+func TestCompactCrashLeftoverNeverDoublesSegments(t *testing.T) {
+	// Simulates a crash between writeSegmentLocked (which lands the merged
+	// segment on disk via temp+rename) and the manifest commit that would
+	// have made it live: the orphaned merged segment must not be picked up
+	// by readManifest, so a restart's mergeSegments can't double-count it
+	// on top of the still-live originals.
+	dir := t.TempDir()
+	original := []segment{
+		{path: filepath.Join(dir, "segment-00000000000000000000.pb")},
+		{path: filepath.Join(dir, "segment-00000000000000000001.pb")},
+	}
+	if err := writeManifest(dir, original); err != nil {
+		t.Fatalf("writeManifest(original): %v", err)
+	}
+
+	// Merged segment lands on disk (e.g. via writeSegmentLocked) but the
+	// manifest swap that would make it live never happens.
+	orphan := filepath.Join(dir, "segment-00000000000000000002.pb")
+	if err := os.WriteFile(orphan, []byte("merged"), 0o644); err != nil {
+		t.Fatalf("write orphan segment: %v", err)
+	}
+
+	got, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest after crash: %v", err)
+	}
+	if len(got) != len(original) {
+		t.Fatalf("readManifest after crash: got %d segments, want %d (orphan must not be live)", len(got), len(original))
+	}
+}
+
+// TestWALAppendThenReadAllSurvivesRestartRoundTrip reproduces the bug this
+// request shipped with undetected: walEntry.Patch held unexported
+// protoreflect.Value fields, so every wal.Append failed with "gob: type ...
+// has no exported fields" and segmentedStorage.Store could never durably
+// persist anything. It drives the real Store/Load machinery end to end --
+// encodePatch, wal.Append, a simulated restart (closing and reopening the
+// log file), wal.ReadAll, decodePatch, and applyPatchToMessage.
+//
+// segmentedStorage.Store/Load themselves can't be driven directly here:
+// InverseIndexProto is an ambient type with no definition available in this
+// fragment (see diff_test.go), so fieldmaskpb.FieldMask stands in for it, as
+// it does there.
+func TestWALAppendThenReadAllSurvivesRestartRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "wal.log")
+
+	base := &fieldmaskpb.FieldMask{Paths: []string{"a", "b"}}
+	first := &fieldmaskpb.FieldMask{Paths: []string{"b", "c"}}
+	second := &fieldmaskpb.FieldMask{Paths: []string{"b", "c", "d"}}
+
+	patch1, err := diffMessages(base.ProtoReflect(), first.ProtoReflect())
+	if err != nil {
+		t.Fatalf("diffMessages(base, first): %v", err)
+	}
+	patch2, err := diffMessages(first.ProtoReflect(), second.ProtoReflect())
+	if err != nil {
+		t.Fatalf("diffMessages(first, second): %v", err)
+	}
+
+	w, err := openWAL(walPath)
+	if err != nil {
+		t.Fatalf("openWAL: %v", err)
+	}
+	for i, patch := range []InverseIndexPatch{patch1, patch2} {
+		wp, err := encodePatch(patch)
+		if err != nil {
+			t.Fatalf("encodePatch(%d): %v", i, err)
+		}
+		if err := w.Append(walEntry{Patch: wp}); err != nil {
+			t.Fatalf("Append(%d): %v", i, err)
+		}
+	}
+	if err := w.file.Close(); err != nil {
+		t.Fatalf("close wal before restart: %v", err)
+	}
+
+	// Simulate a restart: reopen the same file instead of reusing w.
+	reopened, err := openWAL(walPath)
+	if err != nil {
+		t.Fatalf("openWAL (restart): %v", err)
+	}
+	entries, err := reopened.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ReadAll: got %d entries, want 2", len(entries))
+	}
+
+	got := &fieldmaskpb.FieldMask{Paths: append([]string(nil), base.Paths...)}
+	for i, e := range entries {
+		patch, err := decodePatch(got.ProtoReflect(), e.Patch)
+		if err != nil {
+			t.Fatalf("decodePatch(%d): %v", i, err)
+		}
+		applyPatchToMessage(got.ProtoReflect(), patch)
+	}
+
+	assertSamePaths(t, got.Paths, second.Paths)
+}
+
+func TestNextSegmentSeqUsesHighestSeqAndSkipsMalformedNames(t *testing.T) {
+	segments := []segment{
+		{path: "/idx/segment-00000000000000000003.pb"},
+		{path: "/idx/segment-00000000000000000007.pb"},
+		{path: "/idx/not-a-segment.pb"},
+	}
+	if got, want := nextSegmentSeq(segments), int64(8); got != want {
+		t.Errorf("nextSegmentSeq() = %d, want %d", got, want)
+	}
+	if got, want := nextSegmentSeq(nil), int64(0); got != want {
+		t.Errorf("nextSegmentSeq(nil) = %d, want %d", got, want)
+	}
+}